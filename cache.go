@@ -0,0 +1,135 @@
+package watcher
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache stores a Renderer's parsed templates. The default, used when no
+// WithCache/WithLRU option is given, is an unbounded map that never
+// evicts, matching the package's original behavior. NewLRUCache adds
+// bounded size and maximum age eviction; callers may also plug in their
+// own implementation (e.g. backed by bigcache or groupcache).
+type Cache interface {
+	// Get returns the entry stored under key, if any.
+	Get(key interface{}) (*watched, bool)
+	// Set stores w under key, evicting another entry first if the cache
+	// is full.
+	Set(key interface{}, w *watched)
+}
+
+// WithCache replaces the Renderer's Cache. The default is an unbounded
+// map; see also WithLRU for the built-in bounded implementation.
+func WithCache(c Cache) Option {
+	return func(r *Renderer) {
+		r.store = c
+	}
+}
+
+// WithLRU replaces the Renderer's Cache with NewLRUCache(maxEntries, maxAge).
+func WithLRU(maxEntries int, maxAge time.Duration) Option {
+	return WithCache(NewLRUCache(maxEntries, maxAge))
+}
+
+// mapCache is the default Cache: an unbounded map that never evicts.
+type mapCache struct {
+	mu sync.RWMutex
+	m  map[interface{}]*watched
+}
+
+func newMapCache() *mapCache {
+	return &mapCache{m: make(map[interface{}]*watched)}
+}
+
+func (c *mapCache) Get(key interface{}) (*watched, bool) {
+	c.mu.RLock()
+	w, ok := c.m[key]
+	c.mu.RUnlock()
+	return w, ok
+}
+
+func (c *mapCache) Set(key interface{}, w *watched) {
+	c.mu.Lock()
+	c.m[key] = w
+	c.mu.Unlock()
+}
+
+// lruEntry is the payload stored in lruCache's list elements.
+type lruEntry struct {
+	key interface{}
+	w   *watched
+}
+
+// lruCache is a Cache bounded by entry count and/or age, backed by
+// container/list for O(1) least-recently-used eviction.
+type lruCache struct {
+	maxEntries int           // <= 0 means unbounded
+	maxAge     time.Duration // -1: entries never expire by age; 0: caching disabled
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[interface{}]*list.Element
+}
+
+// NewLRUCache returns a Cache that holds at most maxEntries entries,
+// evicting the least recently used once exceeded (maxEntries <= 0 means
+// unbounded), and treats entries parsed more than maxAge ago as evicted on
+// access. maxAge of -1 means entries never expire by age; maxAge of 0
+// disables caching entirely (every Set is a no-op and every Get misses).
+func NewLRUCache(maxEntries int, maxAge time.Duration) Cache {
+	return &lruCache{
+		maxEntries: maxEntries,
+		maxAge:     maxAge,
+		ll:         list.New(),
+		items:      make(map[interface{}]*list.Element),
+	}
+}
+
+func (c *lruCache) Get(key interface{}) (*watched, bool) {
+	if c.maxAge == 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if c.maxAge > 0 && time.Since(e.w.cached) > c.maxAge {
+		c.removeLocked(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.w, true
+}
+
+func (c *lruCache) Set(key interface{}, w *watched) {
+	if c.maxAge == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruEntry).w = w
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	el := c.ll.PushFront(&lruEntry{key: key, w: w})
+	c.items[key] = el
+	if c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.removeLocked(c.ll.Back())
+	}
+}
+
+// removeLocked evicts el. c.mu must be held.
+func (c *lruCache) removeLocked(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry).key)
+}
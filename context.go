@@ -0,0 +1,80 @@
+package watcher
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// WithExecTimeout installs a default timeout for ExecuteContext calls
+// whose context has no deadline of its own. It has no effect on Execute
+// or ExecuteTemplate, which have no context to attach a deadline to.
+func WithExecTimeout(d time.Duration) Option {
+	return func(r *Renderer) {
+		r.execTimeout = d
+	}
+}
+
+// ExecuteContext renders the named template out of the cache entry
+// registered under key, the same way ExecuteTemplate does, but abandons
+// the render and returns ctx's error as soon as ctx is done. This bounds
+// template execution against misbehaving custom funcs or accidental
+// recursion via {{template}}. If ctx has no deadline and the Renderer was
+// built WithExecTimeout, that timeout is applied.
+//
+// The underlying template.ExecuteTemplate call keeps running on its own
+// goroutine after ExecuteContext returns; any further writes it attempts
+// fail with ctx.Err() instead of reaching w.
+func (r *Renderer) ExecuteContext(ctx context.Context, key interface{}, name string, w io.Writer, data interface{}) error {
+	if _, ok := ctx.Deadline(); !ok && r.execTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.execTimeout)
+		defer cancel()
+	}
+
+	t, err := r.cached(key)
+	if err != nil {
+		return err
+	}
+
+	cw := &cancelWriter{ctx: ctx, w: w}
+	done := make(chan error, 1)
+	go func() {
+		done <- t.ExecuteTemplate(cw, name, data)
+	}()
+
+	select {
+	case <-ctx.Done():
+		cw.abandon()
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+// cancelWriter wraps an io.Writer so that, once abandoned, further Writes
+// fail with the writer's context error instead of reaching the underlying
+// writer from a goroutine the caller has stopped waiting on.
+type cancelWriter struct {
+	ctx context.Context
+	w   io.Writer
+
+	mu        sync.Mutex
+	abandoned bool
+}
+
+func (cw *cancelWriter) Write(p []byte) (int, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.abandoned {
+		return 0, cw.ctx.Err()
+	}
+	return cw.w.Write(p)
+}
+
+func (cw *cancelWriter) abandon() {
+	cw.mu.Lock()
+	cw.abandoned = true
+	cw.mu.Unlock()
+}
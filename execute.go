@@ -0,0 +1,53 @@
+package watcher
+
+import (
+	"html/template"
+	"io"
+	"sync/atomic"
+)
+
+// Execute renders the root template registered under key directly from
+// the cache, without the Clone that Get performs. It is the fast path
+// for callers that only read the template (the common case):
+// html/template is safe for concurrent Execute, and a reparse triggered
+// by a change replaces the cache entry's pointer rather than mutating it
+// in place, so a template fetched from the cache remains valid to
+// execute even if a concurrent reparse swaps it out right after. In
+// Development mode this reparses on a stale hit exactly as Get does, so
+// a change on disk is picked up the same way through either path.
+func (r *Renderer) Execute(key interface{}, w io.Writer, data interface{}) error {
+	t, err := r.cached(key)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
+
+// ExecuteTemplate renders the named template out of the cache entry
+// registered under key, the same way Execute does for the root template.
+func (r *Renderer) ExecuteTemplate(key interface{}, w io.Writer, name string, data interface{}) error {
+	t, err := r.cached(key)
+	if err != nil {
+		return err
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
+
+// cached returns the template currently registered under key without
+// cloning it, for callers that only read the template. It shares
+// resolve with get, so a stale or evicted entry is reparsed the same
+// way Get's would be. A key that recently failed to look up or parse
+// short-circuits to the remembered error instead of redoing the work;
+// see WithNegativeTTL.
+func (r *Renderer) cached(key interface{}) (*template.Template, error) {
+	if err, ok := r.negativeHit(key); ok {
+		atomic.AddInt64(&r.stats.negativeHits, 1)
+		return nil, err
+	}
+
+	w, err := r.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+	return w.template, nil
+}
@@ -0,0 +1,123 @@
+package watcher
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// RegisterFS parses the files matched by patterns out of fsys and adds the
+// result to the cache under key, equivalent to
+// template.ParseFS(fsys, patterns...). Unlike RegisterFiles/RegisterGlob,
+// fsys is not watched with fsnotify; changes are detected with fs.Stat
+// instead, unless fsys is immutable (see WithImmutableFS).
+func (r *Renderer) RegisterFS(key interface{}, fsys fs.FS, patterns ...string) error {
+	w, err := r.parseFS(fsys, patterns...)
+	if err != nil {
+		return err
+	}
+
+	r.setChan <- &cacheSet{
+		key: key,
+		w:   w,
+	}
+
+	r.setRegistration(key, &registration{fsys: fsys, patterns: patterns})
+
+	return nil
+}
+
+// RegisterBaseFS parses the files matched by patterns out of fsys as a
+// base template to be added to each cached template, equivalent to
+// template.ParseFS(fsys, patterns...).
+func (r *Renderer) RegisterBaseFS(fsys fs.FS, patterns ...string) error {
+	w, err := r.parseBaseFS(fsys, patterns...)
+	if err != nil {
+		return err
+	}
+
+	r.setChan <- &cacheSet{
+		key: baseKey,
+		w:   w,
+	}
+
+	r.setRegistration(baseKey, &registration{fsys: fsys, patterns: patterns})
+
+	return nil
+}
+
+// parseFS parses patterns out of fsys into a cached template, merged with
+// the base template, if any.
+func (r *Renderer) parseFS(fsys fs.FS, patterns ...string) (*watched, error) {
+	t := template.New(patterns[0]).Delims(r.delimLeft, r.delimRight).Funcs(r.funcs)
+	t, err := t.ParseFS(fsys, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	if base, err := r.Get(baseKey); err == nil {
+		if t, err = mergeTemplate(base, t); err != nil {
+			return nil, err
+		}
+	}
+
+	return &watched{
+		fsys:      fsys,
+		patterns:  patterns,
+		immutable: r.immutableFS || isImmutableFS(fsys),
+		template:  t,
+		cached:    time.Now(),
+		baseGen:   atomic.LoadInt32(&r.baseGeneration),
+	}, nil
+}
+
+// parseBaseFS parses patterns out of fsys into a cached base template.
+func (r *Renderer) parseBaseFS(fsys fs.FS, patterns ...string) (*watched, error) {
+	t := template.New(patterns[0]).Delims(r.delimLeft, r.delimRight).Funcs(r.funcs)
+	t, err := t.ParseFS(fsys, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &watched{
+		fsys:      fsys,
+		patterns:  patterns,
+		immutable: r.immutableFS || isImmutableFS(fsys),
+		template:  t,
+		cached:    time.Now(),
+	}, nil
+}
+
+// isImmutableFS reports whether fsys is known to never change once built,
+// such as an embed.FS baked into the binary.
+func isImmutableFS(fsys fs.FS) bool {
+	_, ok := fsys.(embed.FS)
+	return ok
+}
+
+// getFSChangeTime returns the latest modification time among the files
+// matched by patterns in fsys.
+func getFSChangeTime(fsys fs.FS, patterns ...string) time.Time {
+	var changed time.Time
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		for _, name := range matches {
+			fi, err := fs.Stat(fsys, name)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			if fi.ModTime().After(changed) {
+				changed = fi.ModTime()
+			}
+		}
+	}
+	return changed
+}
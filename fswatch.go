@@ -0,0 +1,196 @@
+package watcher
+
+import (
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fsWatch watches the files backing a Renderer's cache and reports changes
+// through onChange, so that get only reparses when something actually
+// changed instead of stat-ing every dependency on every call.
+//
+// It also watches the parent directory of glob-registered keys so that
+// files created after registration are picked up.
+type fsWatch struct {
+	w     *fsnotify.Watcher
+	mu    sync.Mutex
+	keys  map[string]map[interface{}]bool // watched path -> cache keys depending on it
+	dirs  map[string]map[interface{}]bool // watched directory -> cache keys globbing in it
+	globs map[interface{}]string          // cache key -> original glob pattern
+
+	// onChange is called whenever a watched path changes. filenames is
+	// non-nil only when key was glob-registered and has just been
+	// re-globbed.
+	onChange func(key interface{}, filenames []string)
+
+	// disabled is true when fsnotify could not be started (e.g. ENOSYS on
+	// a platform without inotify/kqueue support). Callers fall back to
+	// mtime polling in get.
+	disabled bool
+}
+
+// newFsWatch starts an fsnotify watcher that reports changes through
+// onChange. If fsnotify can't be started on this platform, the returned
+// fsWatch is disabled and every method is a no-op.
+func newFsWatch(onChange func(key interface{}, filenames []string)) *fsWatch {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Println("watcher: fsnotify unavailable, falling back to mtime polling:", err)
+		return &fsWatch{disabled: true}
+	}
+
+	fw := &fsWatch{
+		w:        w,
+		keys:     make(map[string]map[interface{}]bool),
+		dirs:     make(map[string]map[interface{}]bool),
+		globs:    make(map[interface{}]string),
+		onChange: onChange,
+	}
+	go fw.loop()
+	return fw
+}
+
+// watch registers filenames as dependencies of key. If pattern is
+// non-empty, key was registered via a glob and the pattern's parent
+// directory is also watched so new matches are picked up.
+func (fw *fsWatch) watch(key interface{}, pattern string, filenames []string) {
+	if fw.disabled {
+		return
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if pattern != "" {
+		fw.globs[key] = pattern
+		fw.addDirLocked(filepath.Dir(pattern), key)
+	}
+	for _, f := range filenames {
+		fw.addLocked(f, key)
+	}
+}
+
+// watchPartials registers a shared partials bundle as a dependency of key,
+// the same way watch does for a key's own glob, but without recording
+// pattern in fw.globs: a partials bundle is re-globbed fresh by
+// composeLayout on every reparse, so there's nothing to report back
+// through onChange's filenames parameter, and doing so would overwrite
+// key's own filenames with the partials bundle's matches instead. A
+// change to any matched file, or a new file appearing in the bundle's
+// directory, simply marks key dirty.
+func (fw *fsWatch) watchPartials(key interface{}, pattern string, filenames []string) {
+	if fw.disabled {
+		return
+	}
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	fw.addDirLocked(filepath.Dir(pattern), key)
+	for _, f := range filenames {
+		fw.addLocked(f, key)
+	}
+}
+
+// addLocked starts watching path, if not already watched, and records it
+// as a dependency of key. fw.mu must be held.
+func (fw *fsWatch) addLocked(path string, key interface{}) {
+	if fw.keys[path] == nil {
+		if err := fw.w.Add(path); err != nil {
+			log.Println("watcher: failed to watch", path, err)
+			return
+		}
+		fw.keys[path] = make(map[interface{}]bool)
+	}
+	fw.keys[path][key] = true
+}
+
+// addDirLocked starts watching dir, if not already watched, and records
+// key as depending on whatever dir's glob pattern matches. fsnotify
+// reports directory-level events with event.Name set to the changed
+// child's full path, never the directory's own path, so these have to be
+// tracked separately from the exact-path watches in fw.keys: a file
+// that's new since registration has no entry in fw.keys yet, but its
+// parent directory does here. fw.mu must be held.
+func (fw *fsWatch) addDirLocked(dir string, key interface{}) {
+	if fw.dirs[dir] == nil {
+		if err := fw.w.Add(dir); err != nil {
+			log.Println("watcher: failed to watch", dir, err)
+			return
+		}
+		fw.dirs[dir] = make(map[interface{}]bool)
+	}
+	fw.dirs[dir][key] = true
+}
+
+// loop dispatches fsnotify events to the keys that depend on them until
+// the underlying watcher is closed.
+func (fw *fsWatch) loop() {
+	for {
+		select {
+		case event, ok := <-fw.w.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			fw.handle(event.Name)
+		case err, ok := <-fw.w.Errors:
+			if !ok {
+				return
+			}
+			log.Println("watcher: fsnotify error:", err)
+		}
+	}
+}
+
+// handle reports every key depending on path as changed. path's parent
+// directory is also checked against the keys glob-watching it, since
+// fsnotify reports directory-level events (a file created in or removed
+// from a watched directory) with event.Name set to that child path, not
+// the directory's own path. Any such key's pattern is re-globbed first so
+// newly added or removed files are reflected before the next reparse.
+func (fw *fsWatch) handle(path string) {
+	fw.mu.Lock()
+	keys := make(map[interface{}]bool, len(fw.keys[path])+len(fw.dirs[filepath.Dir(path)]))
+	for key := range fw.keys[path] {
+		keys[key] = true
+	}
+	for key := range fw.dirs[filepath.Dir(path)] {
+		keys[key] = true
+	}
+	fw.mu.Unlock()
+
+	for key := range keys {
+		fw.mu.Lock()
+		pattern, isGlob := fw.globs[key]
+		fw.mu.Unlock()
+
+		var filenames []string
+		if isGlob {
+			if matches, err := filepath.Glob(pattern); err == nil {
+				filenames = matches
+				fw.mu.Lock()
+				for _, f := range filenames {
+					fw.addLocked(f, key)
+				}
+				fw.mu.Unlock()
+			}
+		}
+
+		fw.onChange(key, filenames)
+	}
+}
+
+// close stops the fsnotify watcher, releasing its resources. Safe to call
+// on a disabled fsWatch.
+func (fw *fsWatch) close() error {
+	if fw.disabled {
+		return nil
+	}
+	return fw.w.Close()
+}
@@ -0,0 +1,151 @@
+package watcher
+
+import (
+	"html/template"
+	"time"
+)
+
+// layoutKey identifies a named layout registered with RegisterLayout,
+// distinct from the single global base template keyed by baseKey.
+type layoutKey string
+
+// layoutName reports the layout name key refers to, if it is a layoutKey.
+func layoutName(key interface{}) (string, bool) {
+	lk, ok := key.(layoutKey)
+	return string(lk), ok
+}
+
+// isLayoutKey reports whether key identifies a registered layout.
+func isLayoutKey(key interface{}) bool {
+	_, ok := key.(layoutKey)
+	return ok
+}
+
+// RegisterOption configures how RegisterFiles composes a key's template
+// out of a layout, a shared partials bundle, and the page itself.
+type RegisterOption func(*registerConfig)
+
+// registerConfig collects the RegisterOptions passed to RegisterFiles.
+type registerConfig struct {
+	layout   string // name of a layout registered with RegisterLayout
+	partials string // glob pattern for a shared partials bundle
+}
+
+// WithLayout selects a named layout, registered with RegisterLayout, to
+// merge into the page instead of the single global base template.
+func WithLayout(name string) RegisterOption {
+	return func(c *registerConfig) {
+		c.layout = name
+	}
+}
+
+// WithPartials merges the files matched by pattern into the page's
+// template, ahead of the page itself, so the page (and its layout, if
+// any) can reference them. Equivalent to template.ParseGlob(pattern).
+func WithPartials(pattern string) RegisterOption {
+	return func(c *registerConfig) {
+		c.partials = pattern
+	}
+}
+
+// RegisterLayout registers filenames as a named layout template, selected
+// per key with WithLayout. Unlike the single global base template (see
+// RegisterBaseFiles), a Renderer can register any number of named
+// layouts, e.g. one per section of a site.
+func RegisterLayout(name string, filenames ...string) error {
+	defaultRenderer.setDelims(DelimLeft, DelimRight)
+	return defaultRenderer.RegisterLayout(name, filenames...)
+}
+
+// RegisterLayout registers filenames as a named layout template, selected
+// per key with WithLayout. Unlike the single global base template (see
+// RegisterBaseFiles), a Renderer can register any number of named
+// layouts, e.g. one per section of a site.
+func (r *Renderer) RegisterLayout(name string, filenames ...string) error {
+	w, err := r.parseBaseFiles(filenames...)
+	if err != nil {
+		return err
+	}
+
+	key := layoutKey(name)
+	r.setChan <- &cacheSet{
+		key: key,
+		w:   w,
+	}
+
+	r.setRegistration(key, &registration{filenames: filenames})
+	r.fsWatch.watch(key, "", filenames)
+
+	return nil
+}
+
+// composeLayout merges cfg's layout (or, absent one, the global base
+// template) and partials bundle into t, in that order, the same way the
+// global base template has always been merged into a freshly parsed
+// page.
+func (r *Renderer) composeLayout(t *template.Template, cfg registerConfig) (*template.Template, error) {
+	var merged *template.Template
+	if cfg.layout != "" {
+		layout, err := r.Get(layoutKey(cfg.layout))
+		if err != nil {
+			return nil, err
+		}
+		merged = layout
+	} else if base, err := r.Get(baseKey); err == nil {
+		merged = base
+	}
+
+	if cfg.partials != "" {
+		filenames, err := parseGlob(cfg.partials)
+		if err != nil {
+			return nil, err
+		}
+		pt := template.New(filenames[0]).Delims(r.delimLeft, r.delimRight).Funcs(r.funcs)
+		pt, err = pt.ParseFiles(filenames...)
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = pt
+		} else if merged, err = mergeTemplate(merged, pt); err != nil {
+			return nil, err
+		}
+	}
+
+	if merged == nil {
+		return t, nil
+	}
+	return mergeTemplate(merged, t)
+}
+
+// getLayoutChangeTime returns the modified time of the named layout's
+// dependencies, used as an mtime-polling fallback when fsnotify is
+// disabled. A name with no registered layout reports unchanged.
+func (r *Renderer) getLayoutChangeTime(name string) time.Time {
+	var changed time.Time
+	layout, ok := r.store.Get(layoutKey(name))
+	if !ok {
+		return changed
+	}
+	return getChangeTime(layout.filenames...)
+}
+
+// bumpLayoutGeneration records that the named layout has been reparsed,
+// so entries merging it know to reparse in turn.
+func (r *Renderer) bumpLayoutGeneration(name string) {
+	r.layoutGenLock.Lock()
+	r.layoutGenCount[name]++
+	r.layoutGenLock.Unlock()
+}
+
+// currentLayoutGeneration returns how many times the named layout has
+// been reparsed. name is empty for entries with no layout, which always
+// report generation 0.
+func (r *Renderer) currentLayoutGeneration(name string) int32 {
+	if name == "" {
+		return 0
+	}
+	r.layoutGenLock.Lock()
+	defer r.layoutGenLock.Unlock()
+	return r.layoutGenCount[name]
+}
@@ -0,0 +1,25 @@
+package watcher
+
+// Mode controls how a Renderer reacts to its dependencies changing on
+// disk.
+type Mode int
+
+const (
+	// Development reparses a cached template whenever one of its
+	// dependencies changes, via fsnotify or, when unavailable, mtime
+	// polling. This is the default.
+	Development Mode = iota
+
+	// Production never checks for changes: Get and Execute always serve
+	// whatever was parsed at registration time, or by Preload. Use this
+	// once templates are baked into a deployment and won't change
+	// underneath the running process.
+	Production
+)
+
+// WithMode sets the Renderer's Mode. The default is Development.
+func WithMode(mode Mode) Option {
+	return func(r *Renderer) {
+		r.mode = mode
+	}
+}
@@ -0,0 +1,139 @@
+package watcher
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WithNegativeTTL enables negative caching: a Get/Execute/ExecuteTemplate
+// that misses (unknown key) or fails to parse (broken template) remembers
+// the error for d, so repeated calls short-circuit instead of redoing the
+// failed work on every request. A parse failure is retried sooner than TTL
+// if the underlying file's modification time moves on, since that likely
+// means the template was fixed. The default, 0, disables negative
+// caching.
+func WithNegativeTTL(d time.Duration) Option {
+	return func(r *Renderer) {
+		r.negativeTTL = d
+	}
+}
+
+// negativeEntry remembers a failed lookup or parse.
+type negativeEntry struct {
+	at  time.Time // when the failure was recorded
+	err error
+
+	// mtime is the dependency modification time observed at failure
+	// time, for parse failures. A fresh mtime lifts the entry early.
+	mtime time.Time
+}
+
+// negativeHit reports the remembered error for key, if negative caching
+// is enabled and the entry hasn't expired or been superseded by a newer
+// file.
+func (r *Renderer) negativeHit(key interface{}) (error, bool) {
+	if r.negativeTTL <= 0 {
+		return nil, false
+	}
+
+	r.negLock.Lock()
+	defer r.negLock.Unlock()
+
+	e, ok := r.neg[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(e.at) > r.negativeTTL {
+		delete(r.neg, key)
+		return nil, false
+	}
+	if !e.mtime.IsZero() {
+		if reg, ok := r.getRegistration(key); ok && r.registrationChangeTime(reg).After(e.mtime) {
+			delete(r.neg, key)
+			return nil, false
+		}
+	}
+	return e.err, true
+}
+
+// recordNegative remembers err for key. mtime, if non-zero, is the
+// dependency modification time observed when the parse failed, so the
+// entry can be lifted early once the file changes again.
+func (r *Renderer) recordNegative(key interface{}, err error, mtime time.Time) {
+	if r.negativeTTL <= 0 {
+		return
+	}
+	r.negLock.Lock()
+	r.neg[key] = &negativeEntry{at: time.Now(), err: err, mtime: mtime}
+	r.negLock.Unlock()
+}
+
+// clearNegative forgets any remembered failure for key, called once it
+// parses successfully again.
+func (r *Renderer) clearNegative(key interface{}) {
+	if r.negativeTTL <= 0 {
+		return
+	}
+	r.negLock.Lock()
+	delete(r.neg, key)
+	r.negLock.Unlock()
+}
+
+// registrationChangeTime returns the current modification time of reg's
+// dependencies, re-globbing if necessary. For a registration composed with
+// WithLayout/WithPartials, the layout and partials dependencies are
+// included too, so a fix to either one lifts a remembered parse failure
+// early, the same as a fix to the page's own files would.
+func (r *Renderer) registrationChangeTime(reg *registration) time.Time {
+	var changed time.Time
+	switch {
+	case reg.fsys != nil:
+		changed = getFSChangeTime(reg.fsys, reg.patterns...)
+	case reg.pattern != "":
+		filenames, err := parseGlob(reg.pattern)
+		if err != nil {
+			return time.Time{}
+		}
+		changed = getChangeTime(filenames...)
+	default:
+		changed = getChangeTime(reg.filenames...)
+	}
+
+	if reg.layout != "" {
+		if t := r.getLayoutChangeTime(reg.layout); t.After(changed) {
+			changed = t
+		}
+	}
+	if reg.partials != "" {
+		if filenames, err := parseGlob(reg.partials); err == nil {
+			if t := getChangeTime(filenames...); t.After(changed) {
+				changed = t
+			}
+		}
+	}
+	return changed
+}
+
+// rendererStats backs Stats with atomically updated counters.
+type rendererStats struct {
+	hits, misses, negativeHits, reparses int64
+}
+
+// Stats reports how effectively a Renderer's cache is serving lookups.
+type Stats struct {
+	Hits         int64 // served from the cache without reparsing
+	Misses       int64 // not in the cache; reparsed or looked up fresh
+	NegativeHits int64 // short-circuited by a remembered failure
+	Reparses     int64 // templates actually parsed, successfully or not
+}
+
+// Stats returns a snapshot of the Renderer's cache counters, collected
+// since it was created.
+func (r *Renderer) Stats() Stats {
+	return Stats{
+		Hits:         atomic.LoadInt64(&r.stats.hits),
+		Misses:       atomic.LoadInt64(&r.stats.misses),
+		NegativeHits: atomic.LoadInt64(&r.stats.negativeHits),
+		Reparses:     atomic.LoadInt64(&r.stats.reparses),
+	}
+}
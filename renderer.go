@@ -0,0 +1,140 @@
+package watcher
+
+import (
+	"html/template"
+	"sync"
+	"time"
+)
+
+// Renderer owns a template cache, its delimiters, funcs and base template,
+// independently of any other Renderer. Most applications only need the
+// package-level functions, which operate on a default Renderer, but
+// Renderer is useful when a process needs more than one independent
+// template set (tests, plugins, multi-tenant servers).
+type Renderer struct {
+	delimLeft  string
+	delimRight string
+	funcs      template.FuncMap
+
+	// store holds parsed templates; see Cache. registry separately
+	// remembers how each key was registered, so an entry evicted from
+	// store can be reparsed from scratch rather than lost.
+	store        Cache
+	registryLock sync.RWMutex
+	registry     map[interface{}]*registration
+
+	baseGeneration int32
+
+	// layoutGeneration tracks, per named layout, how many times it has
+	// been reparsed, so entries built with WithLayout know to reparse
+	// when their layout changes, the same way baseGeneration does for the
+	// single global base template.
+	layoutGenLock  sync.Mutex
+	layoutGenCount map[string]int32
+
+	getChan chan *cacheGet
+	setChan chan *cacheSet
+	done    chan struct{}
+
+	fsWatch *fsWatch
+
+	// mode controls whether the Renderer ever reparses a cached template
+	// after registration; see Mode.
+	mode Mode
+
+	// execTimeout, if non-zero, is the default ExecuteContext timeout
+	// applied when the caller's context has no deadline of its own.
+	execTimeout time.Duration
+
+	// immutableFS, when set by WithImmutableFS, treats every fs.FS source
+	// registered on this Renderer as never changing, regardless of its
+	// concrete type. embed.FS sources are always treated this way.
+	immutableFS bool
+
+	// pendingBase holds the filenames passed to WithBase until NewRenderer
+	// registers them; it is nil once the Renderer is constructed.
+	pendingBase []string
+
+	// negativeTTL, if non-zero, enables negative caching; see
+	// WithNegativeTTL.
+	negativeTTL time.Duration
+	negLock     sync.Mutex
+	neg         map[interface{}]*negativeEntry
+
+	stats rendererStats
+}
+
+// Option configures a Renderer constructed by NewRenderer.
+type Option func(*Renderer)
+
+// WithDelims sets the left and right template delimiters, equivalent to
+// text/template's Delims.
+func WithDelims(left, right string) Option {
+	return func(r *Renderer) {
+		r.delimLeft = left
+		r.delimRight = right
+	}
+}
+
+// WithFuncs sets the FuncMap made available to every template parsed by
+// the Renderer. It is applied before ParseFiles/ParseGlob, so funcs can be
+// referenced anywhere in the registered templates, including the base
+// template.
+func WithFuncs(funcs template.FuncMap) Option {
+	return func(r *Renderer) {
+		r.funcs = funcs
+	}
+}
+
+// WithBase registers filenames as the Renderer's base template, equivalent
+// to calling RegisterBaseFiles right after construction.
+func WithBase(filenames ...string) Option {
+	return func(r *Renderer) {
+		r.pendingBase = filenames
+	}
+}
+
+// WithImmutableFS treats every fs.FS source registered on the Renderer via
+// RegisterFS/RegisterBaseFS as immutable: it is parsed once and never
+// checked for changes again, regardless of the concrete fs.FS type. This
+// is the production mode for fs.FS sources that do happen to support
+// modtime (e.g. os.DirFS) but are known not to change at runtime.
+// embed.FS sources are always treated as immutable, with or without this
+// option.
+func WithImmutableFS() Option {
+	return func(r *Renderer) {
+		r.immutableFS = true
+	}
+}
+
+// NewRenderer creates a Renderer configured by opts.
+func NewRenderer(opts ...Option) (*Renderer, error) {
+	r := &Renderer{
+		registry:       make(map[interface{}]*registration),
+		getChan:        make(chan *cacheGet, 10),
+		setChan:        make(chan *cacheSet, 10),
+		done:           make(chan struct{}),
+		neg:            make(map[interface{}]*negativeEntry),
+		layoutGenCount: make(map[string]int32),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.store == nil {
+		r.store = newMapCache()
+	}
+	r.fsWatch = newFsWatch(r.onFsChange)
+
+	go r.watcher()
+
+	if r.pendingBase != nil {
+		base := r.pendingBase
+		r.pendingBase = nil
+		if err := r.RegisterBaseFiles(base...); err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
@@ -2,115 +2,257 @@
 Package watcher implements caching and live-reload of Go templates (htmp/template).
 
 It supports base template (optional) which is automatically added to each cached
-template.
-
-The package works by checking template file modification time on each get and
-reparse the template if neccessary.
+template. RegisterLayout registers any number of additional named layouts,
+selected per key with WithLayout in place of the base template, optionally
+alongside a shared partials bundle (WithPartials).
+
+The package watches registered files with fsnotify and reparses a template only
+when one of its dependencies actually changes. On platforms or environments
+where fsnotify is unavailable, it falls back to checking file modification time
+on each get.
+
+The package-level functions (RegisterFiles, Get, ...) operate on a default
+Renderer and are kept for backward compatibility. Use NewRenderer directly
+to run an independent template set, e.g. to attach custom funcs or to run
+more than one template set in the same process.
 */
 package watcher
 
 import (
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
-	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // A watched struct keeps track of a cached template.
 type watched struct {
 	filenames []string
+	pattern   string // original glob pattern, empty if not glob-registered
+
+	fsys      fs.FS    // non-nil if registered via RegisterFS/RegisterBaseFS
+	patterns  []string // fs.Glob patterns, set together with fsys
+	immutable bool     // fsys is never checked for changes once parsed
+
+	layout   string // name of a layout merged in instead of the base, if set via WithLayout
+	partials string // glob pattern for a partials bundle merged in, if set via WithPartials
+
 	template  *template.Template
 	cached    time.Time
+	dirty     int32 // atomic; set by fsWatch when a dependency changes
+	baseGen   int32 // baseGeneration at the time this entry was parsed
+	layoutGen int32 // generation of layout at the time this entry was parsed
 }
 
+// DelimLeft and DelimRight set the template delimiters used by the
+// package-level functions. Deprecated: use WithDelims with a Renderer
+// instead.
 var (
 	DelimLeft  string
 	DelimRight string
 )
 
-// The template cache and its mutex.
-var (
-	cache     = make(map[interface{}]*watched)
-	cacheLock sync.RWMutex
-)
+type cacheKey int
 
-// RegisterFiles adds the filenames to the cache under key for retrieval.
-// The template created is equivalent to template.ParseFiles(filenames...).
-func RegisterFiles(key interface{}, filenames ...string) error {
-	w, err := parseFiles(filenames...)
-	if err != nil {
-		return err
-	}
+const baseKey cacheKey = 0
 
-	setChan <- &cacheSet{
-		key: key,
-		w:   w,
+// defaultRenderer backs the package-level functions.
+var defaultRenderer = func() *Renderer {
+	r, err := NewRenderer()
+	if err != nil {
+		// NewRenderer with no options never fails.
+		panic(err)
 	}
+	return r
+}()
 
-	return nil
+// RegisterFiles adds the filenames to the cache under key for retrieval.
+// The template created is equivalent to template.ParseFiles(filenames...),
+// merged with the global base template, if one is registered. Passing
+// WithLayout selects a named layout (see RegisterLayout) to merge instead
+// of the global base, and WithPartials additionally merges in a shared
+// bundle of partial templates.
+func RegisterFiles(key interface{}, filenames []string, opts ...RegisterOption) error {
+	defaultRenderer.setDelims(DelimLeft, DelimRight)
+	return defaultRenderer.RegisterFiles(key, filenames, opts...)
 }
 
 // RegisterGlob adds the files matched by the Glob pattern to the cache
 // under key for retrieval.
 // The template created is equivalent to template.ParseGlob(pattern).
 func RegisterGlob(key interface{}, pattern string) error {
-	filenames, err := parseGlob(pattern)
-	if err != nil {
-		return err
-	}
-	return RegisterFiles(key, filenames...)
+	defaultRenderer.setDelims(DelimLeft, DelimRight)
+	return defaultRenderer.RegisterGlob(key, pattern)
 }
 
 // Get returns the template registered under key. Returns error if nothing
 // is found under key. Modifying the returned template will not change
 // the cached template.
 func Get(key interface{}) (*template.Template, error) {
-	c := make(chan *template.Template, 1)
-	getChan <- &cacheGet{
-		key: key,
-		c:   c,
-	}
-	t, ok := <-c
-	if !ok {
-		return nil, fmt.Errorf("watcher: template not found with key: %T=%v", key, key)
-	}
-
-	return t.Clone()
+	return defaultRenderer.Get(key)
 }
 
-type cacheKey int
-
-const baseKey cacheKey = 0
-
 // RegisterBaseFiles adds the filenames as a base template to be added to
 // each cached template.
 // The template created is equivalent to template.ParseFiles(filenames...).
 func RegisterBaseFiles(filenames ...string) error {
-	w, err := parseBaseFiles(filenames...)
+	defaultRenderer.setDelims(DelimLeft, DelimRight)
+	return defaultRenderer.RegisterBaseFiles(filenames...)
+}
+
+// RegisterBaseGlob adds files matched by the Glob pattern as a base template
+// to be added to each cached template.
+// The template created is equivalent to template.ParseGlob(pattern).
+func RegisterBaseGlob(pattern string) error {
+	defaultRenderer.setDelims(DelimLeft, DelimRight)
+	return defaultRenderer.RegisterBaseGlob(pattern)
+}
+
+// Close releases the default Renderer's fsnotify watches.
+func Close() error {
+	return defaultRenderer.Close()
+}
+
+// setDelims updates the delimiters used for future parses. It exists so
+// the package-level functions can keep honoring the DelimLeft/DelimRight
+// globals.
+func (r *Renderer) setDelims(left, right string) {
+	r.delimLeft = left
+	r.delimRight = right
+}
+
+// RegisterFiles adds the filenames to the cache under key for retrieval.
+// The template created is equivalent to template.ParseFiles(filenames...),
+// merged with the global base template, if one is registered. Passing
+// WithLayout selects a named layout (see RegisterLayout) to merge instead
+// of the global base, and WithPartials additionally merges in a shared
+// bundle of partial templates.
+func (r *Renderer) RegisterFiles(key interface{}, filenames []string, opts ...RegisterOption) error {
+	var cfg registerConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return r.registerFiles(key, "", filenames, cfg)
+}
+
+// RegisterGlob adds the files matched by the Glob pattern to the cache
+// under key for retrieval.
+// The template created is equivalent to template.ParseGlob(pattern).
+func (r *Renderer) RegisterGlob(key interface{}, pattern string) error {
+	filenames, err := parseGlob(pattern)
 	if err != nil {
 		return err
 	}
+	return r.registerFiles(key, pattern, filenames, registerConfig{})
+}
 
-	setChan <- &cacheSet{
-		key: baseKey,
+// registerFiles parses filenames, stores the result under key and starts
+// watching filenames (and, if pattern is non-empty, its parent directory)
+// for changes. If cfg selects a partials bundle, its matched files and
+// parent directory are watched too, so a page using WithPartials doesn't
+// have to fall back to re-globbing and stat-ing the bundle on every get.
+func (r *Renderer) registerFiles(key interface{}, pattern string, filenames []string, cfg registerConfig) error {
+	w, err := r.parseRegisteredFiles(filenames, cfg)
+	if err != nil {
+		return err
+	}
+	w.pattern = pattern
+
+	r.setChan <- &cacheSet{
+		key: key,
 		w:   w,
 	}
 
+	r.setRegistration(key, &registration{pattern: pattern, filenames: filenames, layout: cfg.layout, partials: cfg.partials})
+	r.fsWatch.watch(key, pattern, filenames)
+	if cfg.partials != "" {
+		if partialFilenames, err := parseGlob(cfg.partials); err == nil {
+			r.fsWatch.watchPartials(key, cfg.partials, partialFilenames)
+		}
+	}
+
 	return nil
 }
 
+// RegisterBaseFiles adds the filenames as a base template to be added to
+// each cached template.
+// The template created is equivalent to template.ParseFiles(filenames...).
+func (r *Renderer) RegisterBaseFiles(filenames ...string) error {
+	return r.registerBaseFiles("", filenames...)
+}
+
 // RegisterBaseGlob adds files matched by the Glob pattern as a base template
 // to be added to each cached template.
 // The template created is equivalent to template.ParseGlob(pattern).
-func RegisterBaseGlob(pattern string) error {
+func (r *Renderer) RegisterBaseGlob(pattern string) error {
 	filenames, err := parseGlob(pattern)
 	if err != nil {
 		return err
 	}
-	return RegisterBaseFiles(filenames...)
+	return r.registerBaseFiles(pattern, filenames...)
+}
+
+// registerBaseFiles parses filenames into the base template and starts
+// watching them for changes.
+func (r *Renderer) registerBaseFiles(pattern string, filenames ...string) error {
+	w, err := r.parseBaseFiles(filenames...)
+	if err != nil {
+		return err
+	}
+	w.pattern = pattern
+
+	r.setChan <- &cacheSet{
+		key: baseKey,
+		w:   w,
+	}
+
+	r.setRegistration(baseKey, &registration{pattern: pattern, filenames: filenames})
+	r.fsWatch.watch(baseKey, pattern, filenames)
+
+	return nil
+}
+
+// Get returns the template registered under key. Returns error if nothing
+// is found under key. Modifying the returned template will not change
+// the cached template.
+func (r *Renderer) Get(key interface{}) (*template.Template, error) {
+	if err, ok := r.negativeHit(key); ok {
+		atomic.AddInt64(&r.stats.negativeHits, 1)
+		return nil, err
+	}
+
+	c := make(chan *template.Template, 1)
+	r.getChan <- &cacheGet{
+		key: key,
+		c:   c,
+	}
+	t, ok := <-c
+	if !ok {
+		if err, ok := r.negativeHit(key); ok {
+			atomic.AddInt64(&r.stats.negativeHits, 1)
+			return nil, err
+		}
+		return nil, notFoundError(key)
+	}
+
+	atomic.AddInt64(&r.stats.hits, 1)
+	return t.Clone()
+}
+
+// notFoundError reports that no template is registered under key.
+func notFoundError(key interface{}) error {
+	return fmt.Errorf("watcher: template not found with key: %T=%v", key, key)
+}
+
+// Close releases the Renderer's fsnotify watches and stops its cache
+// loop. The Renderer must not be used afterwards.
+func (r *Renderer) Close() error {
+	close(r.done)
+	return r.fsWatch.close()
 }
 
 // parseGlob parses the glob pattern into a filenames slice.
@@ -126,25 +268,30 @@ func parseGlob(pattern string) ([]string, error) {
 	return filenames, nil
 }
 
-// parseFiles parses the filenames into a cached template.
-// The cached template will be merged with the base template.
-func parseFiles(filenames ...string) (*watched, error) {
-	t := template.New(filenames[0]).Delims(DelimLeft, DelimRight)
-	_, err := t.ParseFiles(filenames...)
+// parseRegisteredFiles parses filenames into a cached template, composed
+// according to cfg: a named layout (or, absent one, the global base
+// template) and a shared partials bundle are merged in ahead of the page
+// itself, in that order.
+func (r *Renderer) parseRegisteredFiles(filenames []string, cfg registerConfig) (*watched, error) {
+	t := template.New(filenames[0]).Delims(r.delimLeft, r.delimRight).Funcs(r.funcs)
+	t, err := t.ParseFiles(filenames...)
 	if err != nil {
 		return nil, err
 	}
 
-	if base, err := Get(baseKey); err == nil {
-		if t, err = mergeTemplate(base, t); err != nil {
-			return nil, err
-		}
+	t, err = r.composeLayout(t, cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	return &watched{
 		filenames: filenames,
+		layout:    cfg.layout,
+		partials:  cfg.partials,
 		template:  t,
 		cached:    time.Now(),
+		baseGen:   atomic.LoadInt32(&r.baseGeneration),
+		layoutGen: r.currentLayoutGeneration(cfg.layout),
 	}, nil
 }
 
@@ -165,8 +312,8 @@ func mergeTemplate(base *template.Template, t *template.Template) (*template.Tem
 }
 
 // parseBaseFiles parses filenames into a cached base template.
-func parseBaseFiles(filenames ...string) (*watched, error) {
-	t := template.New(filenames[0]).Delims(DelimLeft, DelimRight)
+func (r *Renderer) parseBaseFiles(filenames ...string) (*watched, error) {
+	t := template.New(filenames[0]).Delims(r.delimLeft, r.delimRight).Funcs(r.funcs)
 	_, err := t.ParseFiles(filenames...)
 	if err != nil {
 		return nil, err
@@ -189,60 +336,311 @@ type cacheSet struct {
 	w   *watched
 }
 
-// Channels for serving cache requests.
-var (
-	getChan = make(chan *cacheGet, 10)
-	setChan = make(chan *cacheSet, 10)
-)
-
 // watcher is the loop for handling cache requests.
-func watcher() {
+func (r *Renderer) watcher() {
 	for {
 		select {
-		case g := <-getChan:
-			go get(g.key, g.c)
-		case s := <-setChan:
-			set(s.key, s.w)
+		case g := <-r.getChan:
+			go r.get(g.key, g.c)
+		case s := <-r.setChan:
+			r.set(s.key, s.w)
+		case <-r.done:
+			return
 		}
 	}
 }
 
 // set puts w into the cache with key.
-func set(key interface{}, w *watched) {
-	cacheLock.Lock()
-	cache[key] = w
-	cacheLock.Unlock()
+func (r *Renderer) set(key interface{}, w *watched) {
+	r.store.Set(key, w)
+}
+
+// markDirty flags the cache entry under key as needing a reparse. It is
+// called by fsWatch when one of the entry's dependencies changes on disk.
+// If key is the base template or a named layout, its generation counter
+// is bumped regardless of whether the cache still holds its entry: a
+// dependent page's staleness check compares against that counter, not
+// against the base/layout entry's own dirty flag, so the bump must
+// happen even if the cache evicted the base/layout entry first. A plain
+// key the cache has evicted is reparsed from its registration the next
+// time it's fetched anyway, so a miss here is otherwise a no-op.
+func (r *Renderer) markDirty(key interface{}) {
+	if w, ok := r.store.Get(key); ok {
+		atomic.StoreInt32(&w.dirty, 1)
+	}
+	if key == baseKey {
+		atomic.AddInt32(&r.baseGeneration, 1)
+	}
+	if name, ok := layoutName(key); ok {
+		r.bumpLayoutGeneration(name)
+	}
+}
+
+// updateFilenames replaces the filenames tracked for key, used when a
+// glob-registered key's parent directory reports a change and the set of
+// matching files may have grown or shrunk.
+func (r *Renderer) updateFilenames(key interface{}, filenames []string) {
+	if w, ok := r.store.Get(key); ok {
+		w.filenames = filenames
+	}
+}
+
+// onFsChange is the fsWatch callback: it refreshes filenames for
+// re-globbed keys, if any, and marks key dirty.
+func (r *Renderer) onFsChange(key interface{}, filenames []string) {
+	if filenames != nil {
+		r.updateFilenames(key, filenames)
+	}
+	r.markDirty(key)
 }
 
 // get retrieves the cached template with key and send it to c.
 // If no cached templates found, c is closed without sending any template.
-func get(key interface{}, c chan<- *template.Template) {
+func (r *Renderer) get(key interface{}, c chan<- *template.Template) {
 	defer close(c)
-	cacheLock.RLock()
-	w, ok := cache[key]
-	cacheLock.RUnlock()
-	if !ok {
+	w, err := r.resolve(key)
+	if err != nil {
 		return
 	}
-	changed := getChangeTime(w.filenames...)
-	baseChanged := getBaseChangeTime()
-	if w.cached.Before(changed) || (key != baseKey && w.cached.Before(baseChanged)) {
-		var err error
-		if key == baseKey {
-			w, err = parseBaseFiles(w.filenames...)
-		} else {
-			w, err = parseFiles(w.filenames...)
+	c <- w.template
+}
+
+// resolve returns the current cache entry for key, reparsing and
+// swapping it first if the cache evicted it, never held it, or it's
+// stale (see isStale). It is shared by get, the Get/getChan path, and
+// cached, the Execute/ExecuteTemplate/ExecuteContext fast path, so both
+// honor Mode and the fsnotify dirty flag the same way: Execute* used to
+// only reparse a key the cache had evicted, never one that was merely
+// stale, silently breaking live-reload for anything using the fast path.
+func (r *Renderer) resolve(key interface{}) (*watched, error) {
+	w, ok := r.store.Get(key)
+	if !ok {
+		// The cache evicted this key, or never held it. If it was
+		// registered, reparse it from scratch rather than treating it as
+		// not found.
+		atomic.AddInt64(&r.stats.misses, 1)
+		reg, ok := r.getRegistration(key)
+		if !ok {
+			err := notFoundError(key)
+			r.recordNegative(key, err, time.Time{})
+			return nil, err
 		}
+		atomic.AddInt64(&r.stats.reparses, 1)
+		reparsed, err := r.parseRegistration(key, reg)
 		if err != nil {
 			log.Println(err)
-			return
+			r.recordNegative(key, err, r.registrationChangeTime(reg))
+			return nil, err
+		}
+		r.clearNegative(key)
+		r.bumpSharedGeneration(key)
+		r.store.Set(key, reparsed)
+		return reparsed, nil
+	}
+
+	stale := r.isStale(w)
+	if key != baseKey && !isLayoutKey(key) {
+		if w.layout == "" && w.baseGen != atomic.LoadInt32(&r.baseGeneration) {
+			stale = true
+		}
+		if w.layout == "" && r.fsWatch.disabled && w.cached.Before(r.getBaseChangeTime()) {
+			stale = true
+		}
+		if w.layout != "" && w.layoutGen != r.currentLayoutGeneration(w.layout) {
+			stale = true
 		}
-		setChan <- &cacheSet{
+	}
+
+	if stale {
+		atomic.AddInt64(&r.stats.reparses, 1)
+		reparsed, err := r.reparse(key, w)
+		if err != nil {
+			log.Println(err)
+			var mtime time.Time
+			if reg, ok := r.getRegistration(key); ok {
+				mtime = r.registrationChangeTime(reg)
+			}
+			r.recordNegative(key, err, mtime)
+			return nil, err
+		}
+		r.clearNegative(key)
+		w = reparsed
+		r.bumpSharedGeneration(key)
+		r.setChan <- &cacheSet{
 			key: key,
 			w:   w,
 		}
 	}
-	c <- w.template
+	atomic.AddInt64(&r.stats.hits, 1)
+	return w, nil
+}
+
+// bumpSharedGeneration bumps the generation counter a freshly reparsed
+// base template or named layout exposes to its dependents, so entries
+// built on top of it know to reparse in turn. It is a no-op for an
+// ordinary page key. Called from both branches of resolve: a base or
+// layout reparsed after the cache evicted it needs to bump its
+// generation exactly as one reparsed for being stale does, or a
+// dependent page that survived the eviction would keep serving content
+// built on the old base/layout.
+func (r *Renderer) bumpSharedGeneration(key interface{}) {
+	if key == baseKey {
+		atomic.AddInt32(&r.baseGeneration, 1)
+	}
+	if name, ok := layoutName(key); ok {
+		r.bumpLayoutGeneration(name)
+	}
+}
+
+// reparse reparses w's dependencies from scratch, the same way it was
+// originally registered (disk files, glob or fs.FS, base or not).
+func (r *Renderer) reparse(key interface{}, w *watched) (*watched, error) {
+	switch {
+	case key == baseKey && w.fsys != nil:
+		return r.parseBaseFS(w.fsys, w.patterns...)
+	case w.fsys != nil:
+		return r.parseFS(w.fsys, w.patterns...)
+	case key == baseKey, isLayoutKey(key):
+		return r.parseBaseFiles(w.filenames...)
+	default:
+		return r.parseRegisteredFiles(w.filenames, registerConfig{layout: w.layout, partials: w.partials})
+	}
+}
+
+// registration records how a key was registered, so it can be reparsed
+// from scratch even after the cache has evicted its entry.
+type registration struct {
+	pattern   string   // glob pattern, if registered via RegisterGlob/RegisterBaseGlob
+	filenames []string // fixed filenames, if not glob-registered
+
+	fsys     fs.FS    // set if registered via RegisterFS/RegisterBaseFS
+	patterns []string // fs.Glob patterns, set together with fsys
+
+	layout   string // name of a layout merged in, if registered with WithLayout
+	partials string // glob pattern for a partials bundle, if registered with WithPartials
+}
+
+// setRegistration records how key was registered.
+func (r *Renderer) setRegistration(key interface{}, reg *registration) {
+	r.registryLock.Lock()
+	r.registry[key] = reg
+	r.registryLock.Unlock()
+}
+
+// getRegistration returns how key was registered, if it was.
+func (r *Renderer) getRegistration(key interface{}) (*registration, bool) {
+	r.registryLock.RLock()
+	reg, ok := r.registry[key]
+	r.registryLock.RUnlock()
+	return reg, ok
+}
+
+// parseRegistration reparses key from its registration: glob patterns are
+// re-expanded so files added or removed since the last parse are picked
+// up, and fs.FS sources are re-parsed via ParseFS, which re-globs
+// internally.
+func (r *Renderer) parseRegistration(key interface{}, reg *registration) (*watched, error) {
+	if reg.fsys != nil {
+		if key == baseKey {
+			return r.parseBaseFS(reg.fsys, reg.patterns...)
+		}
+		return r.parseFS(reg.fsys, reg.patterns...)
+	}
+
+	filenames := reg.filenames
+	if reg.pattern != "" {
+		fresh, err := parseGlob(reg.pattern)
+		if err != nil {
+			return nil, err
+		}
+		filenames = fresh
+	}
+
+	var w *watched
+	var err error
+	switch {
+	case key == baseKey, isLayoutKey(key):
+		w, err = r.parseBaseFiles(filenames...)
+	default:
+		w, err = r.parseRegisteredFiles(filenames, registerConfig{layout: reg.layout, partials: reg.partials})
+	}
+	if err != nil {
+		return nil, err
+	}
+	w.pattern = reg.pattern
+	return w, nil
+}
+
+// isStale reports whether w needs to be reparsed. In Production mode
+// nothing is ever considered stale: Get and Execute serve whatever was
+// parsed at registration time (or by Preload) without touching the disk.
+// In Development mode, fs.FS sources are checked with fs.Stat unless
+// immutable, disk sources fall back to mtime polling when fsnotify is
+// unavailable, and otherwise rely on the dirty flag fsWatch sets on
+// change — including for a layout or partials bundle, both of which are
+// watched the same way a page's own files are, so the mtime-polling
+// fallback below only matters when fsnotify itself is unavailable.
+func (r *Renderer) isStale(w *watched) bool {
+	if r.mode == Production {
+		return false
+	}
+	if r.fsWatch.disabled {
+		if w.partials != "" {
+			if filenames, err := parseGlob(w.partials); err == nil && w.cached.Before(getChangeTime(filenames...)) {
+				return true
+			}
+		}
+		if w.layout != "" && w.cached.Before(r.getLayoutChangeTime(w.layout)) {
+			return true
+		}
+	}
+	switch {
+	case w.fsys != nil:
+		if w.immutable {
+			return false
+		}
+		return w.cached.Before(getFSChangeTime(w.fsys, w.patterns...))
+	case r.fsWatch.disabled:
+		return w.cached.Before(getChangeTime(w.filenames...))
+	default:
+		return atomic.CompareAndSwapInt32(&w.dirty, 1, 0)
+	}
+}
+
+// Preload parses every registered key eagerly, surfacing template errors
+// at startup instead of on the first Get. The base template, if any, is
+// parsed first, followed by any named layouts, so every other entry
+// merges a fresh copy of whichever one it depends on.
+func (r *Renderer) Preload() error {
+	r.registryLock.RLock()
+	keys := make([]interface{}, 0, len(r.registry))
+	if _, ok := r.registry[baseKey]; ok {
+		keys = append(keys, baseKey)
+	}
+	for key := range r.registry {
+		if isLayoutKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range r.registry {
+		if key != baseKey && !isLayoutKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	r.registryLock.RUnlock()
+
+	for _, key := range keys {
+		reg, ok := r.getRegistration(key)
+		if !ok {
+			continue
+		}
+		w, err := r.parseRegistration(key, reg)
+		if err != nil {
+			return fmt.Errorf("watcher: preload %T=%v: %w", key, key, err)
+		}
+		r.store.Set(key, w)
+	}
+	return nil
 }
 
 // getChangeTime returns the modified time for filenames.
@@ -261,24 +659,25 @@ func getChangeTime(filenames ...string) time.Time {
 	return changed
 }
 
-// getBaseChangeTime returns the modified time of the base template.
-func getBaseChangeTime() time.Time {
+// getBaseChangeTime returns the modified time of the base template's
+// dependencies. An immutable fs.FS-backed base is reported as unchanged.
+func (r *Renderer) getBaseChangeTime() time.Time {
 	var changed time.Time
-	cacheLock.RLock()
-	base, ok := cache[baseKey]
-	cacheLock.RUnlock()
+	base, ok := r.store.Get(baseKey)
 	if !ok {
 		return changed
 	}
-	changed = getChangeTime(base.filenames...)
+	if base.fsys != nil {
+		if base.immutable {
+			return changed
+		}
+		changed = getFSChangeTime(base.fsys, base.patterns...)
+	} else {
+		changed = getChangeTime(base.filenames...)
+	}
 	if base.cached.After(changed) {
 		// solve same time issue (time not accurate enough)
 		return base.cached.Add(time.Nanosecond)
 	}
 	return changed
 }
-
-// init starts the loop for handling cache requests.
-func init() {
-	go watcher()
-}
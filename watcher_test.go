@@ -2,7 +2,13 @@ package watcher
 
 import (
 	"bytes"
+	"context"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 type key int
@@ -11,13 +17,14 @@ const (
 	filesKey key = iota
 	globKey
 	partialKey
+	layoutFilesKey
 )
 
 func TestBaseFilesThenFiles(t *testing.T) {
 	if err := RegisterBaseFiles("base.html"); err != nil {
 		t.Error(err)
 	}
-	if err := RegisterFiles(filesKey, "test.html"); err != nil {
+	if err := RegisterFiles(filesKey, []string{"test.html"}); err != nil {
 		t.Error(err)
 	}
 	temp, err := Get(filesKey)
@@ -34,7 +41,7 @@ func TestBaseFilesThenFiles(t *testing.T) {
 }
 
 func TestFilesThenBaseFiles(t *testing.T) {
-	if err := RegisterFiles(filesKey, "test.html"); err != nil {
+	if err := RegisterFiles(filesKey, []string{"test.html"}); err != nil {
 		t.Error(err)
 	}
 	if err := RegisterBaseFiles("base.html"); err != nil {
@@ -98,7 +105,7 @@ func TestPartial(t *testing.T) {
 	if err := RegisterBaseGlob("partial/*.html"); err != nil {
 		t.Fatal(err)
 	}
-	if err := RegisterFiles(partialKey, "job.html"); err != nil {
+	if err := RegisterFiles(partialKey, []string{"job.html"}); err != nil {
 		t.Fatal(err)
 	}
 	temp, err := Get(partialKey)
@@ -117,3 +124,412 @@ func TestPartial(t *testing.T) {
 		t.Fatalf("expected %q, got %q", "1, Test", b.String())
 	}
 }
+
+func TestLayoutThenFiles(t *testing.T) {
+	DelimLeft, DelimRight = "", ""
+	if err := RegisterLayout("admin", "base.html"); err != nil {
+		t.Error(err)
+	}
+	if err := RegisterFiles(layoutFilesKey, []string{"test.html"}, WithLayout("admin")); err != nil {
+		t.Error(err)
+	}
+	temp, err := Get(layoutFilesKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(bytes.Buffer)
+	if err := temp.ExecuteTemplate(b, "base.html", nil); err != nil {
+		t.Error(err)
+	}
+	if bytes.Compare(b.Bytes(), []byte("Base Test")) != 0 {
+		t.Fatalf("expected %q, got %q", "Base Test", b.String())
+	}
+}
+
+func TestGlobPicksUpNewFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.html"), []byte(`{{define "a.html"}}A{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRenderer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.RegisterGlob("dir", filepath.Join(dir, "*.html")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Get("dir"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "b.html"), []byte(`{{define "b.html"}}B{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Give fsnotify time to report the new file and the watcher
+	// goroutine time to mark the entry dirty.
+	time.Sleep(500 * time.Millisecond)
+
+	temp, err := r.Get("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp.Lookup("b.html") == nil {
+		t.Fatal("expected b.html, added after registration, to be picked up")
+	}
+}
+
+func TestRendererIndependence(t *testing.T) {
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dirA, "page.html"), []byte(`{{define "page.html"}}{{shout "a"}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dirB, "page.html"), []byte(`{{define "page.html"}}{{shout "b"}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	shout := func(s string) string { return s + "!" }
+	a, err := NewRenderer(WithFuncs(template.FuncMap{"shout": shout}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := NewRenderer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if err := a.RegisterFiles("page", []string{filepath.Join(dirA, "page.html")}); err != nil {
+		t.Fatal(err)
+	}
+	// b never registers "shout", so if it shared a's FuncMap or cache,
+	// this would either render with it unexpectedly or fail to parse.
+	if err := b.RegisterFiles("page", []string{filepath.Join(dirB, "page.html")}); err == nil {
+		t.Fatal("expected parse error: shout is not a known function on b")
+	}
+
+	tempA, err := a.Get("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := tempA.ExecuteTemplate(buf, "page.html", nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "a!" {
+		t.Fatalf("expected %q, got %q", "a!", buf.String())
+	}
+
+	if _, err := b.Get("page"); err == nil {
+		t.Fatal("expected b's failed registration to leave nothing under \"page\"")
+	}
+}
+
+func TestRegisterFSRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte(`{{define "page.html"}}FS {{.}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRenderer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.RegisterFS("page", os.DirFS(dir), "page.html"); err != nil {
+		t.Fatal(err)
+	}
+	temp, err := r.Get("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(bytes.Buffer)
+	if err := temp.ExecuteTemplate(b, "page.html", "Test"); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "FS Test" {
+		t.Fatalf("expected %q, got %q", "FS Test", b.String())
+	}
+
+	// os.DirFS supports fs.Stat, so (unlike embed.FS) it's not treated as
+	// immutable: editing the file is picked up on the next Get.
+	if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte(`{{define "page.html"}}FS v2 {{.}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	temp2, err := r.Get("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	if err := temp2.ExecuteTemplate(b, "page.html", "Test"); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "FS v2 Test" {
+		t.Fatalf("expected %q, got %q", "FS v2 Test", b.String())
+	}
+}
+
+func TestProductionModeNeverReparses(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "page.html")
+	if err := os.WriteFile(file, []byte(`{{define "page.html"}}v1{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRenderer(WithMode(Production))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.RegisterFiles("page", []string{file}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(`{{define "page.html"}}v2{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	temp, err := r.Get("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := new(bytes.Buffer)
+	if err := temp.ExecuteTemplate(b, "page.html", nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "v1" {
+		t.Fatalf("Production mode reparsed; expected stale %q, got %q", "v1", b.String())
+	}
+}
+
+func TestPreloadSurfacesBadTemplate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "page.html")
+	if err := os.WriteFile(file, []byte(`{{define "page.html"}}v1{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRenderer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.RegisterFiles("page", []string{file}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Preload(); err != nil {
+		t.Fatalf("Preload failed on a still-valid template: %v", err)
+	}
+
+	// Preload reparses from the registration, not from whatever's in the
+	// cache, so a syntax error introduced since registration must fail
+	// it, surfacing the break at startup instead of on the first Get.
+	if err := os.WriteFile(file, []byte(`{{define "page.html"}}{{.Missing(}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Preload(); err == nil {
+		t.Fatal("expected Preload to surface the broken template")
+	}
+}
+
+func TestExecuteTemplateServesCacheWithoutCloning(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "page.html")
+	if err := os.WriteFile(file, []byte(`{{define "page.html"}}v1{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRenderer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.RegisterFiles("page", []string{file}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Get clones before handing the template out, so adding a define to
+	// it must not leak into the cache entry ExecuteTemplate reads
+	// directly. Mutate the clone before any Execute: html/template
+	// forbids cloning a template that has already executed.
+	cloned, err := r.Get("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cloned.New("extra.html").Parse(`{{define "extra.html"}}extra{{end}}`); err != nil {
+		t.Fatal(err)
+	}
+	if cloned.Lookup("extra.html") == nil {
+		t.Fatal("expected the clone itself to gain extra.html")
+	}
+
+	b := new(bytes.Buffer)
+	if err := r.ExecuteTemplate("page", b, "page.html", nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "v1" {
+		t.Fatalf("expected %q, got %q", "v1", b.String())
+	}
+
+	t2, err := r.cached("page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if t2.Lookup("extra.html") != nil {
+		t.Fatal("mutating Get's clone leaked into the cache entry ExecuteTemplate reads directly")
+	}
+}
+
+func TestExecuteContextTimesOut(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "slow.html")
+	if err := os.WriteFile(file, []byte(`{{define "slow.html"}}{{sleep}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	sleep := func() string {
+		close(started)
+		<-release
+		return ""
+	}
+	defer close(release)
+
+	r, err := NewRenderer(
+		WithFuncs(template.FuncMap{"sleep": sleep}),
+		WithExecTimeout(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.RegisterFiles("slow", []string{file}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.ExecuteContext(context.Background(), "slow", "slow.html", io.Discard, nil)
+	}()
+
+	<-started
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ExecuteContext did not return after its timeout elapsed")
+	}
+}
+
+func TestLRUCacheEvictsAtMaxEntries(t *testing.T) {
+	dir := t.TempDir()
+	for _, key := range []string{"a", "b", "c"} {
+		file := filepath.Join(dir, key+".html")
+		if err := os.WriteFile(file, []byte(`{{define "`+key+`.html"}}`+key+`{{end}}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewRenderer(WithLRU(2, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Registering also Sets the entry into the cache, so with room for
+	// only 2 entries, registering c evicts the least recently touched of
+	// the three, a (b was registered more recently and neither has been
+	// Get yet).
+	if err := r.RegisterFiles("a", []string{filepath.Join(dir, "a.html")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RegisterFiles("b", []string{filepath.Join(dir, "b.html")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RegisterFiles("c", []string{filepath.Join(dir, "c.html")}); err != nil {
+		t.Fatal(err)
+	}
+
+	before := r.Stats().Reparses
+	if _, err := r.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Stats().Reparses != before+1 {
+		t.Fatal("expected a, evicted by the cache's 2-entry limit, to be reparsed from its registration")
+	}
+
+	// c was never evicted (only a was, to make room for c) and wasn't
+	// displaced by a's reinsertion above, so it should still be cached.
+	before = r.Stats().Reparses
+	if _, err := r.Get("c"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Stats().Reparses != before {
+		t.Fatal("expected c to still be cached, not reparsed")
+	}
+}
+
+func TestNegativeTTLShortCircuitsRepeatedFailures(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "page.html")
+	if err := os.WriteFile(file, []byte(`{{define "page.html"}}v1{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRenderer(WithNegativeTTL(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := r.RegisterFiles("page", []string{file}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Break the template and wait for fsnotify to mark it dirty.
+	if err := os.WriteFile(file, []byte(`{{define "page.html"}}{{.Missing(}}{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if _, err := r.Get("page"); err == nil {
+		t.Fatal("expected the broken template to fail to parse")
+	}
+	reparsesAfterFirstFailure := r.Stats().Reparses
+
+	// A second lookup, with the file still broken and well within the
+	// TTL, must short-circuit to the remembered error instead of
+	// reparsing the broken file again.
+	if _, err := r.Get("page"); err == nil {
+		t.Fatal("expected the remembered failure to still apply")
+	}
+	if r.Stats().Reparses != reparsesAfterFirstFailure {
+		t.Fatal("expected the second lookup to short-circuit via the negative cache, not reparse")
+	}
+	if r.Stats().NegativeHits == 0 {
+		t.Fatal("expected NegativeHits to be recorded")
+	}
+
+	// Fixing the file moves its mtime forward, which lifts the
+	// remembered failure early, well before the TTL would.
+	if err := os.WriteFile(file, []byte(`{{define "page.html"}}v2{{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if _, err := r.Get("page"); err != nil {
+		t.Fatalf("expected the fix to lift the remembered failure, got: %v", err)
+	}
+}